@@ -0,0 +1,131 @@
+package containerd
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hashicorp/consul-template/signals"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/hashicorp/nomad/plugins/shared/hclspec"
+)
+
+// pluginConfigSpec describes the schema for the plugin/driver level config,
+// i.e. the "plugin \"containerd-driver\" { config { ... } }" stanza in the
+// Nomad client config.
+var pluginConfigSpec = hclspec.NewObject(map[string]*hclspec.Spec{
+	// max_kill_timeout bounds how long a single task's kill_timeout is
+	// allowed to be, regardless of what the task config requests.
+	"max_kill_timeout": hclspec.NewDefault(
+		hclspec.NewAttr("max_kill_timeout", "string", false),
+		hclspec.NewLiteral(`"30s"`),
+	),
+	// containerd_request_timeout bounds each individual containerd API
+	// call made during task shutdown/cleanup, so a wedged containerd
+	// surfaces as a timeout instead of blocking the task runner forever.
+	"containerd_request_timeout": hclspec.NewDefault(
+		hclspec.NewAttr("containerd_request_timeout", "string", false),
+		hclspec.NewLiteral(`"15s"`),
+	),
+})
+
+// taskConfigSpec describes the schema for the task level config, i.e. the
+// "config { ... }" stanza of a "containerd-driver" task.
+var taskConfigSpec = hclspec.NewObject(map[string]*hclspec.Spec{
+	"image":   hclspec.NewAttr("image", "string", true),
+	"command": hclspec.NewAttr("command", "string", false),
+	"args":    hclspec.NewAttr("args", "list(string)", false),
+	// kill_timeout overrides the timeout Nomad passes to StopTask, capped
+	// by the driver's max_kill_timeout.
+	"kill_timeout": hclspec.NewAttr("kill_timeout", "string", false),
+	// kill_signal is the signal sent to the task on shutdown before the
+	// SIGKILL escalation, e.g. "SIGTERM", "SIGQUIT", "SIGHUP".
+	"kill_signal": hclspec.NewAttr("kill_signal", "string", false),
+	// namespace and containerd_address select which containerd instance
+	// and namespace the task's container/task is created in; both are
+	// also persisted in TaskState so RecoverTask can re-attach to the
+	// right daemon after a driver restart.
+	"namespace": hclspec.NewDefault(
+		hclspec.NewAttr("namespace", "string", false),
+		hclspec.NewLiteral(`"default"`),
+	),
+	"containerd_address": hclspec.NewDefault(
+		hclspec.NewAttr("containerd_address", "string", false),
+		hclspec.NewLiteral(`"/run/containerd/containerd.sock"`),
+	),
+})
+
+// Config is the plugin/driver level configuration parsed by SetConfig.
+type Config struct {
+	MaxKillTimeout           string `codec:"max_kill_timeout"`
+	ContainerdRequestTimeout string `codec:"containerd_request_timeout"`
+}
+
+// TaskConfig is the driver specific task configuration parsed out of the
+// jobspec's "config" stanza for a containerd-driver task.
+type TaskConfig struct {
+	Image             string   `codec:"image"`
+	Command           string   `codec:"command"`
+	Args              []string `codec:"args"`
+	KillTimeout       string   `codec:"kill_timeout"`
+	KillSignal        string   `codec:"kill_signal"`
+	Namespace         string   `codec:"namespace"`
+	ContainerdAddress string   `codec:"containerd_address"`
+}
+
+// capabilities indicates what optional features this driver supports.
+var capabilities = &drivers.Capabilities{
+	SendSignals: true,
+	Exec:        false,
+	FSIsolation: drivers.FSIsolationImage,
+}
+
+// supportedSignals lists the symbolic signal names `nomad alloc signal`
+// users can send to a containerd-driver task, backed by the same
+// signals.SignalLookup table consul-template (and the exec2 driver) use.
+func supportedSignals() []string {
+	names := make([]string, 0, len(signals.SignalLookup))
+	for name := range signals.SignalLookup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// killTimeoutFor computes the effective kill timeout for a task: the task's
+// own kill_timeout if set, bounded by the driver's max_kill_timeout, falling
+// back to the timeout Nomad passed in (nomadTimeout) when the task didn't
+// configure one.
+func killTimeoutFor(taskKillTimeout string, maxKillTimeout string, nomadTimeout time.Duration) time.Duration {
+	timeout := nomadTimeout
+
+	if taskKillTimeout != "" {
+		if d, err := time.ParseDuration(taskKillTimeout); err == nil {
+			timeout = d
+		}
+	}
+
+	if maxKillTimeout != "" {
+		if max, err := time.ParseDuration(maxKillTimeout); err == nil && timeout > max {
+			timeout = max
+		}
+	}
+
+	return timeout
+}
+
+// requestTimeoutFor computes the timeout to bound individual containerd API
+// calls with: the driver's configured containerd_request_timeout, falling
+// back to killTimeout when unset or unparseable. A configured value is used
+// as is, even when it is longer than killTimeout.
+func requestTimeoutFor(containerdRequestTimeout string, killTimeout time.Duration) time.Duration {
+	if containerdRequestTimeout == "" {
+		return killTimeout
+	}
+
+	d, err := time.ParseDuration(containerdRequestTimeout)
+	if err != nil {
+		return killTimeout
+	}
+
+	return d
+}
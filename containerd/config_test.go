@@ -0,0 +1,123 @@
+package containerd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKillTimeoutFor(t *testing.T) {
+	cases := []struct {
+		name            string
+		taskKillTimeout string
+		maxKillTimeout  string
+		nomadTimeout    time.Duration
+		expect          time.Duration
+	}{
+		{
+			name:         "falls back to nomad timeout when task and max are unset",
+			nomadTimeout: 5 * time.Second,
+			expect:       5 * time.Second,
+		},
+		{
+			name:            "uses task kill_timeout when set",
+			taskKillTimeout: "10s",
+			nomadTimeout:    5 * time.Second,
+			expect:          10 * time.Second,
+		},
+		{
+			name:            "bounds task kill_timeout by max_kill_timeout",
+			taskKillTimeout: "60s",
+			maxKillTimeout:  "30s",
+			nomadTimeout:    5 * time.Second,
+			expect:          30 * time.Second,
+		},
+		{
+			name:           "bounds nomad timeout by max_kill_timeout when task unset",
+			maxKillTimeout: "10s",
+			nomadTimeout:   30 * time.Second,
+			expect:         10 * time.Second,
+		},
+		{
+			name:            "ignores unparsable task kill_timeout",
+			taskKillTimeout: "not-a-duration",
+			nomadTimeout:    5 * time.Second,
+			expect:          5 * time.Second,
+		},
+		{
+			name:            "ignores unparsable max_kill_timeout",
+			taskKillTimeout: "10s",
+			maxKillTimeout:  "not-a-duration",
+			nomadTimeout:    5 * time.Second,
+			expect:          10 * time.Second,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := killTimeoutFor(c.taskKillTimeout, c.maxKillTimeout, c.nomadTimeout)
+			if got != c.expect {
+				t.Errorf("killTimeoutFor(%q, %q, %s) = %s; want %s", c.taskKillTimeout, c.maxKillTimeout, c.nomadTimeout, got, c.expect)
+			}
+		})
+	}
+}
+
+func TestRequestTimeoutFor(t *testing.T) {
+	cases := []struct {
+		name                     string
+		containerdRequestTimeout string
+		killTimeout              time.Duration
+		expect                   time.Duration
+	}{
+		{
+			name:        "falls back to kill timeout when unset",
+			killTimeout: 15 * time.Second,
+			expect:      15 * time.Second,
+		},
+		{
+			name:                     "uses configured request timeout",
+			containerdRequestTimeout: "20s",
+			killTimeout:              15 * time.Second,
+			expect:                   20 * time.Second,
+		},
+		{
+			name:                     "falls back to kill timeout when unparsable",
+			containerdRequestTimeout: "not-a-duration",
+			killTimeout:              15 * time.Second,
+			expect:                   15 * time.Second,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := requestTimeoutFor(c.containerdRequestTimeout, c.killTimeout)
+			if got != c.expect {
+				t.Errorf("requestTimeoutFor(%q, %s) = %s; want %s", c.containerdRequestTimeout, c.killTimeout, got, c.expect)
+			}
+		})
+	}
+}
+
+func TestLookupSignal(t *testing.T) {
+	t.Run("resolves known signal names", func(t *testing.T) {
+		sig, err := lookupSignal("SIGUSR1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sig.String() != "user defined signal 1" {
+			t.Errorf("lookupSignal(\"SIGUSR1\") = %v; want user defined signal 1", sig)
+		}
+	})
+
+	t.Run("is case-insensitive", func(t *testing.T) {
+		if _, err := lookupSignal("sigterm"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("errors on unsupported signal", func(t *testing.T) {
+		if _, err := lookupSignal("not-a-signal"); err == nil {
+			t.Error("expected an error for an unsupported signal name, got nil")
+		}
+	})
+}
@@ -0,0 +1,385 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
+	"github.com/hashicorp/consul-template/signals"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/plugins/base"
+	"github.com/hashicorp/nomad/plugins/drivers"
+)
+
+const pluginName = "containerd-driver"
+
+// taskStore is a simple in-memory, concurrency-safe store of the
+// taskHandles the driver currently knows about, keyed by Nomad task ID.
+type taskStore struct {
+	lock  sync.RWMutex
+	store map[string]*taskHandle
+}
+
+func newTaskStore() *taskStore {
+	return &taskStore{store: map[string]*taskHandle{}}
+}
+
+func (ts *taskStore) Set(id string, handle *taskHandle) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.store[id] = handle
+}
+
+func (ts *taskStore) Get(id string) (*taskHandle, bool) {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+	h, ok := ts.store[id]
+	return h, ok
+}
+
+func (ts *taskStore) Delete(id string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	delete(ts.store, id)
+}
+
+// Driver is the containerd task driver. It defines SetConfig, Capabilities
+// and the task lifecycle methods below (StartTask, RecoverTask, StopTask,
+// DestroyTask, TaskStats, SignalTask); the other drivers.DriverPlugin
+// methods, such as WaitTask, InspectTask and Fingerprint, are not defined.
+type Driver struct {
+	logger hclog.Logger
+
+	// config is the plugin level configuration, set via SetConfig.
+	config *Config
+
+	// tasks tracks the in-flight taskHandles owned by this driver.
+	tasks *taskStore
+}
+
+func NewPlugin(logger hclog.Logger) *Driver {
+	return &Driver{
+		logger: logger.Named(pluginName),
+		config: &Config{},
+		tasks:  newTaskStore(),
+	}
+}
+
+func (d *Driver) SetConfig(cfg *base.Config) error {
+	var config Config
+	if len(cfg.PluginConfig) != 0 {
+		if err := base.MsgPackDecode(cfg.PluginConfig, &config); err != nil {
+			return fmt.Errorf("failed to decode plugin config: %v", err)
+		}
+	}
+
+	d.config = &config
+
+	return nil
+}
+
+func (d *Driver) Capabilities() (*drivers.Capabilities, error) {
+	return capabilities, nil
+}
+
+// StopTask signals the task to shut down, honoring the task's configured
+// kill_signal/kill_timeout (bounded by the driver's max_kill_timeout) before
+// escalating to SIGKILL.
+func (d *Driver) StopTask(taskID string, timeout time.Duration, signal string) error {
+	h, ok := d.tasks.Get(taskID)
+	if !ok {
+		return drivers.ErrTaskNotFound
+	}
+
+	cfg, err := decodeDriverTaskConfig(h.taskConfig)
+	if err != nil {
+		return fmt.Errorf("failed to decode task config: %v", err)
+	}
+
+	killSignal := syscall.SIGTERM
+	switch {
+	case signal != "":
+		if killSignal, err = lookupSignal(signal); err != nil {
+			return err
+		}
+	case cfg.KillSignal != "":
+		if killSignal, err = lookupSignal(cfg.KillSignal); err != nil {
+			return err
+		}
+	}
+
+	effectiveTimeout := killTimeoutFor(cfg.KillTimeout, d.config.MaxKillTimeout, timeout)
+	requestTimeout := requestTimeoutFor(d.config.ContainerdRequestTimeout, effectiveTimeout)
+
+	return h.shutdown(h.containerdCtx(), effectiveTimeout, requestTimeout, killSignal)
+}
+
+// DestroyTask removes the task's containerd container/task resources.
+func (d *Driver) DestroyTask(taskID string, force bool) error {
+	h, ok := d.tasks.Get(taskID)
+	if !ok {
+		return drivers.ErrTaskNotFound
+	}
+
+	maxKillTimeout := killTimeoutFor("", d.config.MaxKillTimeout, 30*time.Second)
+	requestTimeout := requestTimeoutFor(d.config.ContainerdRequestTimeout, maxKillTimeout)
+
+	if h.IsRunning() {
+		if !force {
+			return fmt.Errorf("cannot destroy running task")
+		}
+		if err := h.forceKill(h.containerdCtx(), requestTimeout); err != nil {
+			return fmt.Errorf("failed to force kill task before destroy: %v", err)
+		}
+	}
+
+	if err := h.cleanup(h.containerdCtx(), requestTimeout); err != nil {
+		return err
+	}
+
+	d.tasks.Delete(taskID)
+	return nil
+}
+
+// StartTask pulls the task's image, creates a containerd container and task
+// from it, and starts it running. The resulting TaskState is attached to
+// the returned handle via SetDriverState so RecoverTask can re-attach to
+// this container after a driver restart.
+func (d *Driver) StartTask(cfg *drivers.TaskConfig) (*drivers.TaskHandle, *drivers.DriverNetwork, error) {
+	if _, ok := d.tasks.Get(cfg.ID); ok {
+		return nil, nil, fmt.Errorf("task with ID %q already started", cfg.ID)
+	}
+
+	var driverConfig TaskConfig
+	if err := cfg.DecodeDriverConfig(&driverConfig); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode driver config: %v", err)
+	}
+
+	namespace := driverConfig.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	address := driverConfig.ContainerdAddress
+	if address == "" {
+		address = "/run/containerd/containerd.sock"
+	}
+
+	client, err := containerd.New(address, containerd.WithDefaultNamespace(namespace))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to containerd at %q: %v", address, err)
+	}
+
+	ctx := namespaces.WithNamespace(context.Background(), namespace)
+
+	image, err := client.Pull(ctx, driverConfig.Image, containerd.WithPullUnpack)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to pull image %q: %v", driverConfig.Image, err)
+	}
+
+	containerName := cfg.ID
+	args := append([]string{driverConfig.Command}, driverConfig.Args...)
+
+	container, err := client.NewContainer(
+		ctx,
+		containerName,
+		containerd.WithNewSnapshot(containerName+"-snapshot", image),
+		containerd.WithNewSpec(oci.WithImageConfig(image), oci.WithProcessArgs(args...)),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create container %q: %v", containerName, err)
+	}
+
+	task, err := container.NewTask(ctx, cio.NewCreator(cio.WithStdio))
+	if err != nil {
+		d.cleanupOrphanedContainer(ctx, client, container, containerName)
+		return nil, nil, fmt.Errorf("failed to create task for container %q: %v", containerName, err)
+	}
+
+	h := &taskHandle{
+		logger:        d.logger.With("task_name", cfg.Name, "task_id", cfg.ID),
+		taskConfig:    cfg,
+		procState:     drivers.TaskStateRunning,
+		startedAt:     time.Now().Round(time.Millisecond),
+		containerName: containerName,
+		container:     container,
+		task:          task,
+		ctxContainerd: ctx,
+		client:        client,
+	}
+
+	handle := drivers.NewTaskHandle(taskHandleVersion)
+	handle.Config = cfg
+
+	driverState := TaskState{
+		TaskConfig:        cfg,
+		ContainerName:     containerName,
+		ContainerID:       container.ID(),
+		Namespace:         namespace,
+		ContainerdAddress: address,
+		StartedAt:         h.startedAt,
+	}
+	if err := handle.SetDriverState(&driverState); err != nil {
+		if delErr := task.Delete(ctx); delErr != nil {
+			d.logger.Error("failed to clean up task after SetDriverState failure", "container", containerName, "error", delErr)
+		}
+		d.cleanupOrphanedContainer(ctx, client, container, containerName)
+		return nil, nil, fmt.Errorf("failed to set driver state: %v", err)
+	}
+
+	d.tasks.Set(cfg.ID, h)
+
+	go h.run(ctx)
+	go d.handleWait(ctx, h)
+
+	return handle, nil, nil
+}
+
+// cleanupOrphanedContainer best-effort deletes a container (and its
+// snapshot) created earlier in StartTask once a later step in the same call
+// has failed, and closes the containerd client opened for it, since no
+// taskHandle was ever stored to reach either of them later.
+func (d *Driver) cleanupOrphanedContainer(ctx context.Context, client *containerd.Client, container containerd.Container, containerName string) {
+	if err := container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+		d.logger.Error("failed to clean up orphaned container", "container", containerName, "error", err)
+	}
+	if err := client.Close(); err != nil {
+		d.logger.Error("failed to close containerd client for orphaned container", "container", containerName, "error", err)
+	}
+}
+
+// RecoverTask re-attaches to a containerd task that was already running
+// when the driver restarted, using the TaskState persisted by StartTask.
+func (d *Driver) RecoverTask(handle *drivers.TaskHandle) error {
+	if handle == nil {
+		return fmt.Errorf("error: handle cannot be nil")
+	}
+
+	if _, ok := d.tasks.Get(handle.Config.ID); ok {
+		// Already recovered/tracked, nothing to do.
+		return nil
+	}
+
+	var taskState TaskState
+	if err := handle.GetDriverState(&taskState); err != nil {
+		return fmt.Errorf("failed to decode task state from handle: %v", err)
+	}
+
+	client, err := containerd.New(taskState.ContainerdAddress, containerd.WithDefaultNamespace(taskState.Namespace))
+	if err != nil {
+		return fmt.Errorf("failed to connect to containerd at %q: %v", taskState.ContainerdAddress, err)
+	}
+
+	ctx := namespaces.WithNamespace(context.Background(), taskState.Namespace)
+
+	container, err := client.LoadContainer(ctx, taskState.ContainerName)
+	if err != nil {
+		return fmt.Errorf("failed to load container %q: %v", taskState.ContainerName, err)
+	}
+
+	task, err := container.Task(ctx, cio.Load)
+	if err != nil {
+		return fmt.Errorf("failed to re-attach to task for container %q: %v", taskState.ContainerName, err)
+	}
+
+	h := &taskHandle{
+		logger:        d.logger.With("task_name", taskState.TaskConfig.Name, "task_id", taskState.TaskConfig.ID),
+		taskConfig:    taskState.TaskConfig,
+		procState:     drivers.TaskStateRunning,
+		startedAt:     taskState.StartedAt,
+		containerName: taskState.ContainerName,
+		container:     container,
+		task:          task,
+		ctxContainerd: ctx,
+		client:        client,
+	}
+
+	d.tasks.Set(taskState.TaskConfig.ID, h)
+
+	go d.handleWait(ctx, h)
+
+	return nil
+}
+
+// handleWait blocks on the containerd task's exit and records the result on
+// h so that h.TaskStatus (and Nomad) observes it, even though
+// no StartTask caller is around to see it directly, e.g. after recovery.
+func (d *Driver) handleWait(ctx context.Context, h *taskHandle) {
+	exitStatusC, err := h.task.Wait(ctx)
+	if err != nil {
+		d.logger.Error("failed to wait on containerd task", "container", h.containerName, "error", err)
+		return
+	}
+
+	status := <-exitStatusC
+
+	h.stateLock.Lock()
+	defer h.stateLock.Unlock()
+
+	h.procState = drivers.TaskStateExited
+	h.completedAt = time.Now()
+	h.exitResult = &drivers.ExitResult{
+		ExitCode: int(status.ExitCode()),
+	}
+}
+
+func (d *Driver) TaskStats(ctx context.Context, taskID string, interval time.Duration) (<-chan *drivers.TaskResourceUsage, error) {
+	h, ok := d.tasks.Get(taskID)
+	if !ok {
+		return nil, drivers.ErrTaskNotFound
+	}
+
+	return h.stats(ctx, interval)
+}
+
+// SignalTask resolves a symbolic signal name (e.g. "SIGUSR1", as sent by
+// `nomad alloc signal`) and delivers it to the task.
+func (d *Driver) SignalTask(taskID string, signal string) error {
+	h, ok := d.tasks.Get(taskID)
+	if !ok {
+		return drivers.ErrTaskNotFound
+	}
+
+	sig, err := lookupSignal(signal)
+	if err != nil {
+		return err
+	}
+
+	return h.signal(h.containerdCtx(), sig)
+}
+
+// lookupSignal resolves a symbolic signal name (e.g. "SIGQUIT", "SIGUSR1")
+// to a syscall.Signal using the same signals.SignalLookup table the exec2
+// driver uses, so users can send any signal name Nomad understands.
+func lookupSignal(name string) (syscall.Signal, error) {
+	s, ok := signals.SignalLookup[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported signal %q, must be one of: %s", name, strings.Join(supportedSignals(), ", "))
+	}
+
+	sig, ok := s.(syscall.Signal)
+	if !ok {
+		return 0, fmt.Errorf("unsupported signal %q: %T is not a syscall.Signal", name, s)
+	}
+
+	return sig, nil
+}
+
+// decodeDriverTaskConfig pulls the driver-specific TaskConfig back out of
+// the opaque drivers.TaskConfig Nomad hands the driver.
+func decodeDriverTaskConfig(taskConfig *drivers.TaskConfig) (*TaskConfig, error) {
+	var cfg TaskConfig
+	if taskConfig == nil {
+		return &cfg, nil
+	}
+	if err := taskConfig.DecodeDriverConfig(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -2,12 +2,16 @@ package containerd
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"sync"
 	"syscall"
 	"time"
 
+	v1 "github.com/containerd/cgroups/stats/v1"
+	v2 "github.com/containerd/cgroups/v2/stats"
 	"github.com/containerd/containerd"
+	"github.com/containerd/typeurl"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/plugins/drivers"
 )
@@ -28,6 +32,17 @@ type taskHandle struct {
 	containerName string
 	container     containerd.Container
 	task          containerd.Task
+
+	// client is the containerd client backing container/task, owned by
+	// this handle. It is closed in cleanup once the task/container have
+	// been deleted, since nothing else holds a reference to it.
+	client *containerd.Client
+
+	// ctxContainerd is the long-lived context the driver uses to talk to
+	// containerd for the lifetime of the task. It is stashed here so that
+	// background goroutines (e.g. stats collection) started after run()
+	// can be shut down alongside containerd's own context.
+	ctxContainerd context.Context
 }
 
 func (h *taskHandle) TaskStatus() *drivers.TaskStatus {
@@ -53,27 +68,46 @@ func (h *taskHandle) IsRunning() bool {
 	return h.procState == drivers.TaskStateRunning
 }
 
+// containerdCtx returns h.ctxContainerd under stateLock, since it is written
+// concurrently (e.g. by run()) with reads from driver methods like StopTask
+// and SignalTask.
+func (h *taskHandle) containerdCtx() context.Context {
+	h.stateLock.RLock()
+	defer h.stateLock.RUnlock()
+	return h.ctxContainerd
+}
+
 func (h *taskHandle) run(ctxContainerd context.Context) {
 	h.stateLock.Lock()
 	defer h.stateLock.Unlock()
 
+	h.ctxContainerd = ctxContainerd
+
 	// Sleep for 5 seconds to allow h.task.Wait() to kick in.
 	time.Sleep(5 * time.Second)
 
 	h.task.Start(ctxContainerd)
 }
 
-func (h *taskHandle) shutdown(ctxContainerd context.Context, timeout time.Duration, signal syscall.Signal) error {
-	if err := h.task.Kill(ctxContainerd, signal); err != nil {
+// shutdown sends signal to the task, waits the full timeout (even if the task
+// exits sooner), and then sends SIGKILL if the task is still running. timeout
+// is the effective kill timeout already computed by the caller (task
+// kill_timeout, bounded by the
+// driver's max_kill_timeout). requestTimeout bounds each individual
+// containerd API call so a wedged containerd surfaces as a timeout error
+// instead of blocking this goroutine past timeout.
+func (h *taskHandle) shutdown(ctxContainerd context.Context, timeout time.Duration, requestTimeout time.Duration, signal syscall.Signal) error {
+	killCtx, cancel := context.WithTimeout(ctxContainerd, requestTimeout)
+	defer cancel()
+	if err := h.task.Kill(killCtx, signal); err != nil {
 		return err
 	}
 
-	// timeout = 5 seconds, passed by nomad client
-	// TODO: Make timeout configurable in task_config. This will allow users to set a higher timeout
-	// if they need more time for their container to shutdown gracefully.
 	time.Sleep(timeout)
 
-	status, err := h.task.Status(ctxContainerd)
+	statusCtx, cancel := context.WithTimeout(ctxContainerd, requestTimeout)
+	defer cancel()
+	status, err := h.task.Status(statusCtx)
 	if err != nil {
 		return err
 	}
@@ -83,23 +117,199 @@ func (h *taskHandle) shutdown(ctxContainerd context.Context, timeout time.Durati
 		return nil
 	}
 
-	return h.task.Kill(ctxContainerd, syscall.SIGKILL)
+	sigkillCtx, cancel := context.WithTimeout(ctxContainerd, requestTimeout)
+	defer cancel()
+	return h.task.Kill(sigkillCtx, syscall.SIGKILL)
 }
 
-func (h *taskHandle) cleanup(ctxContainerd context.Context) error {
-	if _, err := h.task.Delete(ctxContainerd); err != nil {
+// forceKill sends SIGKILL and blocks until the task has actually exited (or
+// requestTimeout elapses), since containerd's task.Delete requires the task
+// to have exited first. This is used by force-destroy, which must tear down
+// a still-running task rather than erroring out like a plain shutdown would.
+func (h *taskHandle) forceKill(ctxContainerd context.Context, requestTimeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctxContainerd, requestTimeout)
+	defer cancel()
+
+	exitStatusC, err := h.task.Wait(waitCtx)
+	if err != nil {
+		return fmt.Errorf("failed to wait on task: %v", err)
+	}
+
+	killCtx, killCancel := context.WithTimeout(ctxContainerd, requestTimeout)
+	defer killCancel()
+	if err := h.task.Kill(killCtx, syscall.SIGKILL); err != nil {
+		return fmt.Errorf("failed to SIGKILL task: %v", err)
+	}
+
+	select {
+	case <-exitStatusC:
+		return nil
+	case <-waitCtx.Done():
+		return fmt.Errorf("timed out waiting for task to exit: %v", waitCtx.Err())
+	}
+}
+
+// cleanup removes the task's containerd task and container, bounding each
+// API call by requestTimeout so a wedged containerd doesn't block cleanup
+// indefinitely. It also closes h.client, the containerd connection StartTask
+// or RecoverTask opened for this task, since nothing else references it
+// once the task/container are gone.
+func (h *taskHandle) cleanup(ctxContainerd context.Context, requestTimeout time.Duration) error {
+	deleteTaskCtx, cancel := context.WithTimeout(ctxContainerd, requestTimeout)
+	defer cancel()
+	if _, err := h.task.Delete(deleteTaskCtx); err != nil {
 		return err
 	}
-	if err := h.container.Delete(ctxContainerd, containerd.WithSnapshotCleanup); err != nil {
+
+	deleteContainerCtx, cancel := context.WithTimeout(ctxContainerd, requestTimeout)
+	defer cancel()
+	if err := h.container.Delete(deleteContainerCtx, containerd.WithSnapshotCleanup); err != nil {
 		return err
 	}
+
+	if h.client != nil {
+		if err := h.client.Close(); err != nil {
+			h.logger.Error("failed to close containerd client", "container", h.containerName, "error", err)
+		}
+	}
+
 	return nil
 }
 
 func (h *taskHandle) stats(ctx context.Context, interval time.Duration) (<-chan *drivers.TaskResourceUsage, error) {
-	return nil, nil
+	ch := make(chan *drivers.TaskResourceUsage)
+	go h.handleStats(ctx, ch, interval)
+	return ch, nil
+}
+
+// handleStats polls containerd for task metrics every interval and pushes
+// translated drivers.TaskResourceUsage values onto ch until either ctx (the
+// stats subscriber) or h.ctxContainerd (the task's own lifetime) is done.
+func (h *taskHandle) handleStats(ctx context.Context, ch chan<- *drivers.TaskResourceUsage, interval time.Duration) {
+	defer close(ch)
+
+	ctxContainerd := h.containerdCtx()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ctxContainerd.Done():
+			return
+		case <-ticker.C:
+		}
+
+		usage, err := h.taskResourceUsage(ctxContainerd)
+		if err != nil {
+			h.logger.Error("failed to collect containerd task metrics", "error", err)
+			continue
+		}
+
+		select {
+		case ch <- usage:
+		case <-ctx.Done():
+			return
+		case <-ctxContainerd.Done():
+			return
+		}
+	}
+}
+
+// taskResourceUsage fetches the raw metrics for h.task from containerd and
+// translates them into Nomad's TaskResourceUsage. Both cgroupv1 (v1.Metrics)
+// and cgroupv2 (v2.Metrics) payloads are supported, since the typeurl value
+// returned depends on the cgroup driver of the host the task is running on.
+func (h *taskHandle) taskResourceUsage(ctxContainerd context.Context) (*drivers.TaskResourceUsage, error) {
+	metrics, err := h.task.Metrics(ctxContainerd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch task metrics: %v", err)
+	}
+
+	data, err := typeurl.UnmarshalAny(metrics.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal task metrics: %v", err)
+	}
+
+	cpuStats, memoryStats, err := translateContainerdMetrics(data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &drivers.TaskResourceUsage{
+		ResourceUsage: &drivers.ResourceUsage{
+			CpuStats:    cpuStats,
+			MemoryStats: memoryStats,
+		},
+		Timestamp: now.UTC().UnixNano(),
+	}, nil
+}
+
+// translateContainerdMetrics translates the typeurl-decoded payload from
+// h.task.Metrics into Nomad's CpuStats/MemoryStats. Both cgroupv1
+// (*v1.Metrics) and cgroupv2 (*v2.Metrics) payloads are supported, since the
+// shape returned depends on the cgroup driver of the host the task runs on.
+func translateContainerdMetrics(data interface{}) (*drivers.CpuStats, *drivers.MemoryStats, error) {
+	cpuStats := &drivers.CpuStats{}
+	memoryStats := &drivers.MemoryStats{}
+
+	switch m := data.(type) {
+	case *v1.Metrics:
+		if cpu := m.GetCPU(); cpu != nil {
+			if usage := cpu.GetUsage(); usage != nil {
+				cpuStats.TotalTicks = float64(usage.GetTotal())
+				cpuStats.SystemMode = float64(usage.GetKernel())
+				cpuStats.UserMode = float64(usage.GetUser())
+			}
+			if throttling := cpu.GetThrottling(); throttling != nil {
+				cpuStats.ThrottledPeriods = throttling.GetThrottledPeriods()
+				cpuStats.ThrottledTime = throttling.GetThrottledTime()
+			}
+			cpuStats.Measured = []string{"System Mode", "User Mode", "Throttled Periods", "Throttled Time"}
+		}
+
+		if mem := m.GetMemory(); mem != nil {
+			memoryStats.RSS = mem.GetRSS()
+			memoryStats.Cache = mem.GetCache()
+			memoryStats.Swap = mem.GetSwap().GetUsage()
+			if usage := mem.GetUsage(); usage != nil {
+				memoryStats.Usage = usage.GetUsage()
+				memoryStats.MaxUsage = usage.GetMax()
+			}
+			memoryStats.Measured = []string{"RSS", "Cache", "Swap", "Usage", "Max Usage"}
+		}
+	case *v2.Metrics:
+		if cpu := m.GetCPU(); cpu != nil {
+			cpuStats.TotalTicks = float64(cpu.GetUsageUsec()) * 1000
+			cpuStats.SystemMode = float64(cpu.GetSystemUsec()) * 1000
+			cpuStats.UserMode = float64(cpu.GetUserUsec()) * 1000
+			cpuStats.ThrottledPeriods = cpu.GetNrThrottled()
+			cpuStats.ThrottledTime = cpu.GetThrottledUsec() * 1000
+			cpuStats.Measured = []string{"System Mode", "User Mode", "Throttled Periods", "Throttled Time"}
+		}
+
+		if mem := m.GetMemory(); mem != nil {
+			memoryStats.RSS = mem.GetAnon()
+			memoryStats.Cache = mem.GetFile()
+			memoryStats.Swap = mem.GetSwapUsage()
+			memoryStats.Usage = mem.GetUsage()
+			memoryStats.Measured = []string{"RSS", "Cache", "Swap", "Usage"}
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported containerd metrics type: %T", data)
+	}
+
+	return cpuStats, memoryStats, nil
 }
 
 func (h *taskHandle) signal(ctxContainerd context.Context, sig os.Signal) error {
-	return h.task.Kill(ctxContainerd, sig.(syscall.Signal))
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal type: %T", sig)
+	}
+
+	return h.task.Kill(ctxContainerd, s)
 }
@@ -0,0 +1,89 @@
+package containerd
+
+import (
+	"testing"
+
+	v1 "github.com/containerd/cgroups/stats/v1"
+	v2 "github.com/containerd/cgroups/v2/stats"
+)
+
+func TestTranslateContainerdMetricsV1(t *testing.T) {
+	data := &v1.Metrics{
+		CPU: &v1.CPUStat{
+			Usage: &v1.CPUUsage{
+				Total:  1000,
+				Kernel: 200,
+				User:   800,
+			},
+			Throttling: &v1.Throttle{
+				ThrottledPeriods: 3,
+				ThrottledTime:    42,
+			},
+		},
+		Memory: &v1.MemoryStat{
+			RSS:   111,
+			Cache: 222,
+			Swap:  &v1.MemoryEntry{Usage: 5},
+			Usage: &v1.MemoryEntry{Usage: 333, Max: 444},
+		},
+	}
+
+	cpu, mem, err := translateContainerdMetrics(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cpu.TotalTicks != 1000 || cpu.SystemMode != 200 || cpu.UserMode != 800 {
+		t.Errorf("unexpected CpuStats: %+v", cpu)
+	}
+	if cpu.ThrottledPeriods != 3 || cpu.ThrottledTime != 42 {
+		t.Errorf("unexpected throttling stats: %+v", cpu)
+	}
+
+	if mem.RSS != 111 || mem.Cache != 222 || mem.Swap != 5 {
+		t.Errorf("unexpected MemoryStats: %+v", mem)
+	}
+	if mem.Usage != 333 || mem.MaxUsage != 444 {
+		t.Errorf("unexpected memory usage stats: %+v", mem)
+	}
+}
+
+func TestTranslateContainerdMetricsV2(t *testing.T) {
+	data := &v2.Metrics{
+		CPU: &v2.CPUStat{
+			UsageUsec:     1000,
+			SystemUsec:    200,
+			UserUsec:      800,
+			NrThrottled:   3,
+			ThrottledUsec: 42,
+		},
+		Memory: &v2.MemoryStat{
+			Anon:      111,
+			File:      222,
+			SwapUsage: 5,
+			Usage:     333,
+		},
+	}
+
+	cpu, mem, err := translateContainerdMetrics(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cpu.TotalTicks != 1000000 || cpu.SystemMode != 200000 || cpu.UserMode != 800000 {
+		t.Errorf("unexpected CpuStats (usec->nsec conversion): %+v", cpu)
+	}
+	if cpu.ThrottledPeriods != 3 || cpu.ThrottledTime != 42000 {
+		t.Errorf("unexpected throttling stats: %+v", cpu)
+	}
+
+	if mem.RSS != 111 || mem.Cache != 222 || mem.Swap != 5 || mem.Usage != 333 {
+		t.Errorf("unexpected MemoryStats: %+v", mem)
+	}
+}
+
+func TestTranslateContainerdMetricsUnsupportedType(t *testing.T) {
+	if _, _, err := translateContainerdMetrics(struct{}{}); err == nil {
+		t.Error("expected an error for an unsupported metrics type, got nil")
+	}
+}
@@ -0,0 +1,25 @@
+package containerd
+
+import (
+	"time"
+
+	"github.com/hashicorp/nomad/plugins/drivers"
+)
+
+// taskHandleVersion is the drivers.TaskHandle version, used by Nomad to detect an incompatible TaskState
+// left over from a previous version of the driver across upgrades.
+const taskHandleVersion = 1
+
+// TaskState is the runtime state that is persisted via
+// drivers.TaskHandle.SetDriverState and returned to the driver in
+// RecoverTask. It must contain all of the information needed to re-attach
+// to a running containerd task after the plugin (or the Nomad client) has
+// restarted.
+type TaskState struct {
+	TaskConfig        *drivers.TaskConfig
+	ContainerName     string
+	ContainerID       string
+	Namespace         string
+	ContainerdAddress string
+	StartedAt         time.Time
+}